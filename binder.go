@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TypeBinding pins a field (or a primitive class) to an explicit Go type
+// expression, optionally imported from another package.
+type TypeBinding struct {
+	GoType string
+	Import string
+}
+
+// TypeBinder maps dotted BSON field paths (e.g. "orders.items.sku", or a
+// bare leaf key like "email") to an explicit Go type, analogous to
+// gqlgen's models binder. It can also pin a whole BSON primitive class
+// (e.g. always rendering PrimitiveTimestamp as some other type) so users
+// can globally swap a primitive's Go representation. Path bindings take
+// precedence over primitive-class bindings.
+type TypeBinder struct {
+	Paths      map[string]TypeBinding
+	Primitives map[PrimitiveType]TypeBinding
+}
+
+// BoundType is a Type produced by a TypeBinder hit: it renders as the
+// user's own Go type instead of anything inferred from the data, and
+// stays that way through merges since the user pinned it deliberately.
+type BoundType struct {
+	TypeBinding
+}
+
+func (b BoundType) GoType(gen *Generator) string { return b.TypeBinding.GoType }
+
+func (b BoundType) Merge(t Type, gen *Generator) Type { return b }
+
+// collectImports walks a generated Type tree and returns the sorted,
+// deduplicated set of import paths required by every BoundType found in
+// it, for injection into the generated file's import block.
+func collectImports(t Type) []string {
+	seen := map[string]bool{}
+	var walk func(Type)
+	walk = func(t Type) {
+		switch v := t.(type) {
+		case BoundType:
+			if v.Import != "" {
+				seen[v.Import] = true
+			}
+		case StructType:
+			for _, f := range v {
+				walk(f)
+			}
+		case SliceType:
+			walk(v.Type)
+		case MixedType:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(t)
+
+	imports := make([]string, 0, len(seen))
+	for imp := range seen {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// primitiveTypeNames maps the config-file spelling of a primitive class
+// (as used in a Target's primitive_overrides) to its PrimitiveType.
+var primitiveTypeNames = map[string]PrimitiveType{
+	"binary":    PrimitiveBinary,
+	"bool":      PrimitiveBool,
+	"double":    PrimitiveDouble,
+	"int32":     PrimitiveInt32,
+	"int64":     PrimitiveInt64,
+	"objectid":  PrimitiveObjectId,
+	"string":    PrimitiveString,
+	"timestamp": PrimitiveTimestamp,
+}
+
+// newTypeBinder builds a TypeBinder from a target's type_overrides and
+// primitive_overrides, or returns nil if neither was set.
+func newTypeBinder(paths map[string]TypeOverride, primitives map[string]TypeOverride) (*TypeBinder, error) {
+	if len(paths) == 0 && len(primitives) == 0 {
+		return nil, nil
+	}
+
+	binder := &TypeBinder{
+		Paths:      make(map[string]TypeBinding, len(paths)),
+		Primitives: make(map[PrimitiveType]TypeBinding, len(primitives)),
+	}
+	for path, o := range paths {
+		binder.Paths[path] = TypeBinding{GoType: o.Type, Import: o.Import}
+	}
+	for name, o := range primitives {
+		prim, ok := primitiveTypeNames[name]
+		if !ok {
+			return nil, fmt.Errorf("mongoschema: unknown primitive class %q in primitive_overrides", name)
+		}
+		binder.Primitives[prim] = TypeBinding{GoType: o.Type, Import: o.Import}
+	}
+	return binder, nil
+}
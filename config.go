@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"labix.org/v2/mgo"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the top-level shape of a mongoschema.yaml file: one mongo URL
+// shared by every target, plus the list of structs to generate. It plays
+// the same role as gqlgen's gqlgen.yml, trading a single struct-per-
+// invocation CLI for a declarative list of generation targets that all run
+// off of one connection.
+type Config struct {
+	URL     string   `yaml:"url"`
+	Targets []Target `yaml:"targets"`
+}
+
+// Target describes a single struct to generate from a single collection.
+type Target struct {
+	DB                 string                  `yaml:"db"`
+	Collection         string                  `yaml:"collection"`
+	Struct             string                  `yaml:"struct"`
+	Package            string                  `yaml:"package"`
+	Output             string                  `yaml:"output"`
+	IgnoredKeys        []string                `yaml:"ignored_keys"`
+	Limit              uint                    `yaml:"limit"`
+	Plugins            []string                `yaml:"plugins"`
+	SampleStrategy     string                  `yaml:"sample_strategy"`
+	SampleSize         uint                    `yaml:"sample_size"`
+	Parallel           uint                    `yaml:"parallel"`
+	TypeOverrides      map[string]TypeOverride `yaml:"type_overrides"`
+	PrimitiveOverrides map[string]TypeOverride `yaml:"primitive_overrides"`
+	NoEnums            bool                    `yaml:"no_enums"`
+	EnumMaxValues      uint                    `yaml:"enum_max_values"`
+	EnumMinSamples     uint                    `yaml:"enum_min_samples"`
+}
+
+// TypeOverride pins a dotted field path (e.g. "user.settings.prefs"), or a
+// primitive class in PrimitiveOverrides, to an explicit Go type expression,
+// optionally imported from another package. Type is required; LoadConfig
+// rejects a config with an empty one rather than silently generating an
+// unbound field. See TypeBinder for how a Target's overrides turn into the
+// BoundType a generated field ends up with.
+type TypeOverride struct {
+	Type   string `yaml:"type"`
+	Import string `yaml:"import"`
+}
+
+// LoadConfig reads and parses a mongoschema config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("mongoschema: parsing %s: %v", path, err)
+	}
+	if cfg.URL == "" {
+		return nil, errEmptyURL
+	}
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("mongoschema: %s declares no targets", path)
+	}
+	for _, t := range cfg.Targets {
+		for fieldPath, o := range t.TypeOverrides {
+			if o.Type == "" {
+				return nil, fmt.Errorf("mongoschema: target %s.%s: type_overrides[%q] has no type", t.DB, t.Collection, fieldPath)
+			}
+		}
+		for prim, o := range t.PrimitiveOverrides {
+			if o.Type == "" {
+				return nil, fmt.Errorf("mongoschema: target %s.%s: primitive_overrides[%q] has no type", t.DB, t.Collection, prim)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// RunConfig connects once and runs Generate for every target in the config
+// at path, writing each target's formatted output to its own file (creating
+// parent directories, i.e. packages, as needed) instead of printing a
+// single struct to stdout.
+func RunConfig(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	session, err := mgo.Dial(cfg.URL)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.EnsureSafe(&mgo.Safe{})
+	session.SetBatch(1000)
+	session.SetMode(mgo.Eventual, true)
+
+	for _, t := range cfg.Targets {
+		binder, err := newTypeBinder(t.TypeOverrides, t.PrimitiveOverrides)
+		if err != nil {
+			return err
+		}
+
+		gen := Generator{
+			Session:        session,
+			DB:             t.DB,
+			Collection:     t.Collection,
+			Struct:         t.Struct,
+			Package:        t.Package,
+			Comments:       true,
+			IgnoredKeys:    t.IgnoredKeys,
+			Limit:          t.Limit,
+			Plugins:        t.Plugins,
+			SampleStrategy: t.SampleStrategy,
+			SampleSize:     t.SampleSize,
+			Parallel:       t.Parallel,
+			Binder:         binder,
+			NoEnums:        t.NoEnums,
+			EnumMaxValues:  t.EnumMaxValues,
+			EnumMinSamples: t.EnumMinSamples,
+		}
+		files, err := gen.Generate()
+		if err != nil {
+			return fmt.Errorf("mongoschema: target %s.%s: %v", t.DB, t.Collection, err)
+		}
+		for _, f := range files {
+			path := t.Output
+			if f.Suffix != "" {
+				path = strings.TrimSuffix(t.Output, filepath.Ext(t.Output)) + f.Suffix
+			}
+			if err := writeGeneratedFile(path, f.Source); err != nil {
+				return fmt.Errorf("mongoschema: writing %s: %v", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func writeGeneratedFile(path string, src []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, src, 0644)
+}
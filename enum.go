@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Defaults for Generator.EnumMaxValues and Generator.EnumMinSamples when
+// left at zero.
+const (
+	defaultEnumMaxValues  = 16
+	defaultEnumMinSamples = 3
+)
+
+// NamedType is a promoted low-cardinality string field: it renders as a
+// named string type plus typed constants instead of a bare string.
+type NamedType struct {
+	Name       string
+	Underlying PrimitiveType
+	Values     []string
+}
+
+func (n NamedType) GoType(gen *Generator) string { return n.Name }
+
+func (n NamedType) Merge(t Type, gen *Generator) Type {
+	if nt, ok := t.(NamedType); ok && nt.Name == n.Name {
+		return n
+	}
+	if n.Underlying.GoType(gen) == t.GoType(gen) {
+		return n
+	}
+	return MixedType{n, t}
+}
+
+// recordStringSample feeds the stringSampler used by enum promotion. It is
+// called from inferType for every observed string leaf, unless -no-enums
+// disabled the feature.
+func (s *Generator) recordStringSample(path, value string) {
+	if s.NoEnums {
+		return
+	}
+	if s.stringSampler == nil {
+		s.stringSampler = map[string]map[string]int{}
+	}
+	samples, ok := s.stringSampler[path]
+	if !ok {
+		samples = map[string]int{}
+		s.stringSampler[path] = samples
+	}
+	samples[value]++
+}
+
+// promoteEnums walks root after the scan completes and replaces any
+// PrimitiveString leaf whose field path was sampled by recordStringSample
+// with a NamedType, provided: its distinct value count is at most
+// s.EnumMaxValues, it was observed at least s.EnumMinSamples times, and
+// every distinct value normalizes to a usable Go identifier.
+//
+// Candidate paths are collected and sorted up front, and each name is
+// assigned from that deterministic order, so the result does not depend on
+// Go's randomized StructType (map) iteration order: the same scan always
+// promotes the same fields to the same names, and two fields that would
+// otherwise collide on the same name (see enumTypeName) are disambiguated
+// instead of one silently shadowing the other.
+func (s *Generator) promoteEnums(root StructType) {
+	if s.NoEnums || len(s.stringSampler) == 0 {
+		return
+	}
+
+	maxValues := s.EnumMaxValues
+	if maxValues == 0 {
+		maxValues = defaultEnumMaxValues
+	}
+	minSamples := s.EnumMinSamples
+	if minSamples == 0 {
+		minSamples = defaultEnumMinSamples
+	}
+
+	var stringPaths []string
+	var collect func(t Type, path string)
+	collect = func(t Type, path string) {
+		switch v := t.(type) {
+		case StructType:
+			for k, f := range v {
+				collect(f, joinPath(path, k))
+			}
+		case SliceType:
+			collect(v.Type, path)
+		case PrimitiveType:
+			if v == PrimitiveString {
+				stringPaths = append(stringPaths, path)
+			}
+		}
+	}
+	for k, f := range root {
+		collect(f, k)
+	}
+	sort.Strings(stringPaths)
+
+	names := make(map[string]string, len(stringPaths))
+	used := map[string]bool{}
+	for _, path := range stringPaths {
+		if !s.qualifiesForEnum(path, maxValues, minSamples) {
+			continue
+		}
+		base := enumTypeName(s.Struct, path)
+		name := base
+		for suffix := 2; used[name]; suffix++ {
+			name = fmt.Sprintf("%s%d", base, suffix)
+		}
+		used[name] = true
+		names[path] = name
+	}
+
+	var apply func(t Type, path string) Type
+	apply = func(t Type, path string) Type {
+		switch v := t.(type) {
+		case StructType:
+			for k, f := range v {
+				v[k] = apply(f, joinPath(path, k))
+			}
+			return v
+		case SliceType:
+			v.Type = apply(v.Type, path)
+			return v
+		case PrimitiveType:
+			if v != PrimitiveString {
+				return v
+			}
+			name, ok := names[path]
+			if !ok {
+				return v
+			}
+			return NamedType{
+				Name:       name,
+				Underlying: PrimitiveString,
+				Values:     s.sortedStringSamples(path),
+			}
+		default:
+			return t
+		}
+	}
+	for k, f := range root {
+		root[k] = apply(f, k)
+	}
+}
+
+// qualifiesForEnum reports whether path's sampled values are eligible for
+// promotion to a NamedType: at most maxValues distinct values, at least
+// minSamples observations, and every distinct value normalizes to a usable
+// Go identifier.
+func (s *Generator) qualifiesForEnum(path string, maxValues, minSamples uint) bool {
+	samples, ok := s.stringSampler[path]
+	if !ok || len(samples) == 0 || uint(len(samples)) > maxValues {
+		return false
+	}
+
+	var total uint
+	for val, count := range samples {
+		total += uint(count)
+		if !isEnumIdentifierCandidate(val) {
+			return false
+		}
+	}
+	return total >= minSamples
+}
+
+// sortedStringSamples returns path's distinct sampled values in sorted
+// order, for a NamedType's Values.
+func (s *Generator) sortedStringSamples(path string) []string {
+	samples := s.stringSampler[path]
+	values := make([]string, 0, len(samples))
+	for val := range samples {
+		values = append(values, val)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// isEnumIdentifierCandidate reports whether v normalizes, via the same
+// split/title-casing makeFieldName uses for field names, to a non-empty
+// name containing at least one letter - ruling out purely numeric or
+// symbolic values that would make for confusing constant names.
+func isEnumIdentifierCandidate(v string) bool {
+	if v == "" {
+		return false
+	}
+	name := makeFieldName(v)
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return true
+		}
+	}
+	return false
+}
+
+// enumTypeName derives the named type's Go identifier from the struct it
+// belongs to and its full dotted field path, e.g. struct "Order" and path
+// "status" becomes "OrderStatus", while "shipping.status" becomes
+// "OrderShippingStatus" - using only the leaf would collide the two.
+func enumTypeName(structName, path string) string {
+	var b strings.Builder
+	b.WriteString(structName)
+	for _, part := range strings.Split(path, ".") {
+		b.WriteString(makeFieldName(part))
+	}
+	return b.String()
+}
+
+// collectNamedTypes walks a generated Type tree and returns every distinct
+// NamedType found in it (deduplicated by Name), for plugins that need to
+// emit their "type X string; const (...)" declarations.
+func collectNamedTypes(t Type) []NamedType {
+	seen := map[string]NamedType{}
+	var order []string
+	var walk func(Type)
+	walk = func(t Type) {
+		switch v := t.(type) {
+		case NamedType:
+			if _, ok := seen[v.Name]; !ok {
+				seen[v.Name] = v
+				order = append(order, v.Name)
+			}
+		case StructType:
+			for _, f := range v {
+				walk(f)
+			}
+		case SliceType:
+			walk(v.Type)
+		case MixedType:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(t)
+
+	sort.Strings(order)
+	named := make([]NamedType, 0, len(order))
+	for _, name := range order {
+		named = append(named, seen[name])
+	}
+	return named
+}
+
+// renderNamedType writes a NamedType's "type X string; const (...)" block.
+func renderNamedType(buf *bytes.Buffer, n NamedType, gen *Generator) {
+	fmt.Fprintf(buf, "type %s %s\n\n", n.Name, n.Underlying.GoType(gen))
+	fmt.Fprint(buf, "const (\n")
+	for _, v := range n.Values {
+		fmt.Fprintf(buf, "\t%s%s %s = %q\n", n.Name, makeFieldName(v), n.Name, v)
+	}
+	fmt.Fprint(buf, ")\n\n")
+}
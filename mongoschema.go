@@ -5,7 +5,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"go/format"
 	"os"
 	"regexp"
 	"strings"
@@ -20,6 +19,7 @@ var errEmptyURL = errors.New("mongoschema: no URL specified")
 
 func main() {
 	var generator Generator
+	config := flag.String("config", "", "path to a mongoschema.yaml config file describing one or more generation targets; overrides all other flags")
 	flag.StringVar(&generator.URL, "url", "", "mongo url for dial")
 	flag.StringVar(&generator.DB, "db", "", "database to use")
 	flag.StringVar(&generator.Collection, "collection", "", "collection to use")
@@ -29,17 +29,41 @@ func main() {
 	flag.BoolVar(&generator.Comments, "comments", true, "output comments in code")
 	flag.UintVar(&generator.Limit, "limit", 0, "maximum number of documents to scan")
 	ignoredKeys := flag.String("ignored-keys", "", "comma separated list of key names to ignore")
+	plugins := flag.String("plugins", "struct", "comma separated list of plugins to run: struct,bsoncodec,crud,validate")
+	flag.StringVar(&generator.SampleStrategy, "sample-strategy", SampleHead, "how to sample documents: head, random or reservoir")
+	flag.UintVar(&generator.SampleSize, "sample-size", 0, "number of documents to sample for random/reservoir strategies (default "+fmt.Sprint(defaultSampleSize)+")")
+	flag.UintVar(&generator.Parallel, "parallel", 0, "scan the collection in this many concurrent shards, partitioned by _id range")
+	flag.BoolVar(&generator.NoEnums, "no-enums", false, "disable promoting low-cardinality string fields to named enum types")
+	flag.UintVar(&generator.EnumMaxValues, "enum-max-values", defaultEnumMaxValues, "promote a string field to an enum only if it has at most this many distinct sampled values")
+	flag.UintVar(&generator.EnumMinSamples, "enum-min-samples", defaultEnumMinSamples, "require at least this many sampled observations before promoting a string field to an enum")
 	flag.Parse()
 
+	if *config != "" {
+		if err := RunConfig(*config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		return
+	}
+
 	generator.IgnoredKeys = strings.Split(*ignoredKeys, ",")
+	generator.Plugins = strings.Split(*plugins, ",")
 
-	if err := generator.Generate(); err != nil {
+	files, err := generator.Generate()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(2)
 	}
+	for _, f := range files {
+		fmt.Printf("%s\n", f.Source)
+	}
 }
 
 type Generator struct {
+	// Session is an already-dialed session to reuse, set by RunConfig when
+	// generating many targets off of one connection. If nil, Generate dials
+	// URL itself and closes the session before returning.
+	Session     *mgo.Session
 	URL         string
 	DB          string
 	Collection  string
@@ -49,57 +73,117 @@ type Generator struct {
 	Comments    bool
 	IgnoredKeys []string
 	Limit       uint
+	// Plugins names the emitters to run over the scanned root, in order.
+	// Defaults to []string{"struct"} (the original, single struct-emitting
+	// behavior) when empty.
+	Plugins []string
+
+	// FieldPresence and TotalDocs are populated by the scan loop in
+	// Generate and consulted by plugins such as validate: FieldPresence[p]
+	// is the number of scanned documents in which dotted path p appeared,
+	// and a field present in every document (FieldPresence[p] ==
+	// TotalDocs) is treated as required.
+	FieldPresence map[string]int
+	TotalDocs     int
+
+	// SampleStrategy, SampleSize and Parallel control how the collection is
+	// scanned; see scan in sampling.go.
+	SampleStrategy string
+	SampleSize     uint
+	Parallel       uint
+
+	// Binder, if set, overrides inferred types by field path or primitive
+	// class. See TypeBinder.
+	Binder *TypeBinder
+
+	// NoEnums disables low-cardinality string promotion; see promoteEnums.
+	NoEnums bool
+	// EnumMaxValues and EnumMinSamples tune that promotion: a field is
+	// promoted only if it has at most EnumMaxValues distinct values, and
+	// at least EnumMinSamples total observations. Zero means use the
+	// package defaults.
+	EnumMaxValues  uint
+	EnumMinSamples uint
+
+	// stringSampler tracks, per field path, the distinct string values
+	// observed and how many times each occurred. Fed from inferType,
+	// consumed by promoteEnums once the scan completes.
+	stringSampler map[string]map[string]int
 }
 
-func (s *Generator) connect() (*mgo.Session, *mgo.Collection, error) {
+func (s *Generator) connect() (*mgo.Collection, bool, error) {
+	if s.Session != nil {
+		return s.Session.DB(s.DB).C(s.Collection), false, nil
+	}
+
 	if s.URL == "" {
-		return nil, nil, errEmptyURL
+		return nil, false, errEmptyURL
 	}
 
 	session, err := mgo.Dial(s.URL)
 	if err != nil {
-		return nil, nil, err
+		return nil, false, err
 	}
 	session.EnsureSafe(&mgo.Safe{})
 	session.SetBatch(1000)
 	session.SetMode(mgo.Eventual, true)
-	return session, session.DB(s.DB).C(s.Collection), nil
+	s.Session = session
+	return session.DB(s.DB).C(s.Collection), true, nil
 }
 
-func (s *Generator) Generate() error {
-	session, collection, err := s.connect()
+// Generate scans s.Collection, then runs s.Plugins over the resulting
+// StructType, returning every file they produce. The caller decides what to
+// do with the result: main prints each file to stdout for the legacy
+// single-target flags, RunConfig writes them under each target's output
+// path.
+func (s *Generator) Generate() ([]GeneratedFile, error) {
+	plugins, err := lookupPlugins(s.Plugins)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	root := StructType{}
-	iter := collection.Find(nil).Iter()
-	m := bson.M{}
-	var seen uint
-	for iter.Next(m) {
-		if s.Limit != 0 && seen == s.Limit {
-			break
-		}
-		root.Merge(NewType(m, s), s)
-		m = bson.M{}
-		seen++
+	collection, dialed, err := s.connect()
+	if err != nil {
+		return nil, err
 	}
-	if err := iter.Close(); err != nil {
-		return err
+	// Only close a session we dialed ourselves; a Session set by the caller
+	// (RunConfig) is shared across targets and closed by the caller.
+	if dialed {
+		defer s.Session.Close()
 	}
-	session.Close()
 
-	const srcFmt = "package %s\ntype %s %s"
-	src := fmt.Sprintf(srcFmt, s.Package, s.Struct, root.GoType(s))
-	if s.Raw {
-		fmt.Println(src)
-	}
-	formatted, err := format.Source([]byte(src))
+	s.FieldPresence = map[string]int{}
+	s.TotalDocs = 0
+	root, err := s.scan(collection)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	s.promoteEnums(root)
+
+	var files []GeneratedFile
+	for _, p := range plugins {
+		fs, err := p.Generate(root, s)
+		if err != nil {
+			return nil, fmt.Errorf("mongoschema: plugin %s: %v", p.Name(), err)
+		}
+		files = append(files, fs...)
+	}
+	return files, nil
+}
+
+// recordPresence walks a scanned document and increments s.FieldPresence
+// for every dotted field path it finds, recursing into nested documents.
+func (s *Generator) recordPresence(m bson.M, prefix string) {
+	for k, v := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		s.FieldPresence[path]++
+		if nested, ok := v.(bson.M); ok {
+			s.recordPresence(nested, path)
+		}
 	}
-	fmt.Printf("%s\n", formatted)
-	return nil
 }
 
 type Type interface {
@@ -278,7 +362,32 @@ func (s StructType) Merge(t Type, gen *Generator) Type {
 	return MixedType{s, t}
 }
 
-func NewType(v interface{}, gen *Generator) Type {
+// NewType infers a Type for v, the value found at the dotted field path
+// path (empty for the document root). Before falling back to that
+// inference it consults gen.Binder: a path binding replaces the inferred
+// type wholesale, and a primitive-class binding (e.g. always rendering
+// PrimitiveTimestamp as some other type) is applied once the primitive
+// class is known.
+func NewType(v interface{}, gen *Generator, path string) Type {
+	if gen.Binder != nil {
+		if tb, ok := gen.Binder.Paths[path]; ok {
+			return BoundType{tb}
+		}
+	}
+
+	t := inferType(v, gen, path)
+
+	if gen.Binder != nil {
+		if prim, ok := t.(PrimitiveType); ok {
+			if tb, ok := gen.Binder.Primitives[prim]; ok {
+				return BoundType{tb}
+			}
+		}
+	}
+	return t
+}
+
+func inferType(v interface{}, gen *Generator, path string) Type {
 	switch i := v.(type) {
 	default:
 		panic(fmt.Sprintf("cannot determine type for %v with go type %T", v, v))
@@ -287,14 +396,14 @@ func NewType(v interface{}, gen *Generator) Type {
 	case bson.ObjectId:
 		return PrimitiveObjectId
 	case bson.M:
-		return NewStructType(i, gen)
+		return NewStructType(i, gen, path)
 	case []interface{}:
 		if len(i) == 0 {
 			return SliceType{Type: MixedType{}}
 		}
 		var s Type
 		for _, v := range i {
-			vt := NewType(v, gen)
+			vt := NewType(v, gen, path)
 			if vt == NilType {
 				continue
 			}
@@ -315,6 +424,7 @@ func NewType(v interface{}, gen *Generator) Type {
 	case bool:
 		return PrimitiveBool
 	case string:
+		gen.recordStringSample(path, i)
 		return PrimitiveString
 	case time.Time, bson.MongoTimestamp:
 		return PrimitiveTimestamp
@@ -325,10 +435,10 @@ func NewType(v interface{}, gen *Generator) Type {
 	}
 }
 
-func NewStructType(m bson.M, gen *Generator) Type {
+func NewStructType(m bson.M, gen *Generator, path string) Type {
 	s := StructType{}
 	for k, v := range m {
-		t := NewType(v, gen)
+		t := NewType(v, gen, joinPath(path, k))
 		if t == NilType {
 			continue
 		}
@@ -337,6 +447,13 @@ func NewStructType(m bson.M, gen *Generator) Type {
 	return s
 }
 
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
 func isValidFieldName(n string) bool {
 	if n == "" {
 		return false
@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+// GeneratedFile is one file a Plugin wants written to disk. Suffix is
+// appended, with extension stripped, to the target's own Output path to
+// derive the file name for anything but a target's primary file, for which
+// Suffix is empty and Output is used verbatim.
+type GeneratedFile struct {
+	Suffix string
+	Source []byte
+}
+
+// Plugin turns a scanned StructType into zero or more generated files.
+// Generator.Generate runs the plugins named in Generator.Plugins, in order,
+// over the same scanned root, similar to govpp's binapigen plugins
+// operating over a shared IR.
+type Plugin interface {
+	Name() string
+	Generate(root StructType, gen *Generator) ([]GeneratedFile, error)
+}
+
+var pluginRegistry = map[string]Plugin{
+	"struct":    structPlugin{},
+	"bsoncodec": bsoncodecPlugin{},
+	"crud":      crudPlugin{},
+	"validate":  validatePlugin{},
+}
+
+// lookupPlugins resolves plugin names in the order given, defaulting to
+// just the struct emitter when none are named.
+func lookupPlugins(names []string) ([]Plugin, error) {
+	if len(names) == 0 {
+		names = []string{"struct"}
+	}
+	plugins := make([]Plugin, 0, len(names))
+	for _, name := range names {
+		p, ok := pluginRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("mongoschema: unknown plugin %q", name)
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+// bsoncodecPlugin emits, for the root type and every nested struct-typed
+// field reachable from it, a GetBSON/SetBSON pair against bson.Raw. mgo
+// dispatches to these whenever a value implements bson.Getter/bson.Setter,
+// which skips the reflection mgo would otherwise do field-by-field. A
+// field is decoded with a direct type assertion only when the dynamic
+// type bson.Raw.Unmarshal produces for it is guaranteed to match its
+// GoType exactly (most PrimitiveType cases, and MixedType, which keeps the
+// raw interface{} value as-is); PrimitiveTimestamp gets its own assertion
+// against either Go shape a timestamp can decode to; everything else
+// (PrimitiveInt32/Int64, SliceType, BoundType, NamedType) is re-marshaled
+// and decoded through bson.Unmarshal's own reflection, since their
+// declared Go type can't be produced by a plain assertion against the
+// generic decode.
+type bsoncodecPlugin struct{}
+
+func (bsoncodecPlugin) Name() string { return "bsoncodec" }
+
+func (bsoncodecPlugin) Generate(root StructType, gen *Generator) ([]GeneratedFile, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", gen.Package)
+	fmt.Fprint(&buf, "import (\n\t\"labix.org/v2/mgo/bson\"\n)\n\n")
+
+	// Render field types without the debug "interface{} /* ... */" comment
+	// mixed types normally carry; it would otherwise land inside generated
+	// code rather than a doc comment.
+	typeGen := *gen
+	typeGen.Comments = false
+
+	emitStructCodec(&buf, gen.Struct, root, &typeGen, map[string]bool{})
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []GeneratedFile{{Suffix: "_bsoncodec.go", Source: formatted}}, nil
+}
+
+// emitStructCodec writes GetBSON/SetBSON for name and recurses into any
+// struct-typed fields, naming each nested type after its parent's name
+// plus its own field name. emitted is keyed by that name, so a name is
+// emitted at most once; fields are never grouped by shared shape.
+func emitStructCodec(buf *bytes.Buffer, name string, s StructType, gen *Generator, emitted map[string]bool) {
+	if emitted[name] {
+		return
+	}
+	emitted[name] = true
+
+	fmt.Fprintf(buf, "func (v *%s) GetBSON() (interface{}, error) {\n", name)
+	fmt.Fprint(buf, "\tm := bson.M{}\n")
+	for k := range s {
+		if !isValidFieldName(k) || sscontains(gen.IgnoredKeys, k) {
+			continue
+		}
+		fmt.Fprintf(buf, "\tm[%q] = v.%s\n", k, makeFieldName(k))
+	}
+	fmt.Fprint(buf, "\treturn m, nil\n}\n\n")
+
+	fmt.Fprintf(buf, "func (v *%s) SetBSON(raw bson.Raw) error {\n", name)
+	fmt.Fprint(buf, "\tvar m bson.M\n\tif err := raw.Unmarshal(&m); err != nil {\n\t\treturn err\n\t}\n")
+	for k, t := range s {
+		if !isValidFieldName(k) || sscontains(gen.IgnoredKeys, k) {
+			continue
+		}
+		field := makeFieldName(k)
+		if nested, ok := t.(StructType); ok {
+			nestedName := name + field
+			fmt.Fprintf(buf, "\tif sub, ok := m[%q].(bson.M); ok {\n", k)
+			fmt.Fprint(buf, "\t\tsubRaw, err := bson.Marshal(sub)\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+			fmt.Fprintf(buf, "\t\tif err := (&v.%s).SetBSON(bson.Raw{Kind: 0x03, Data: subRaw}); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n", field)
+			emitStructCodec(buf, nestedName, nested, gen, emitted)
+			continue
+		}
+
+		if prim, ok := t.(PrimitiveType); ok {
+			switch prim {
+			case PrimitiveTimestamp:
+				// inferType maps both a BSON UTC datetime (kind 0x09, which
+				// bson.Raw.Unmarshal already decodes as time.Time) and the
+				// distinct MongoDB-internal Timestamp (kind 0x11, decoded
+				// as bson.MongoTimestamp - seconds in its high 32 bits) to
+				// this same PrimitiveType. Accept whichever one the
+				// document actually holds.
+				fmt.Fprintf(buf, "\tif val, ok := m[%q]; ok {\n", k)
+				fmt.Fprintf(buf, "\t\tif typed, ok := val.(time.Time); ok {\n\t\t\tv.%s = typed\n\t\t} else if ts, ok := val.(bson.MongoTimestamp); ok {\n\t\t\tv.%s = time.Unix(int64(ts)>>32, 0)\n\t\t}\n\t}\n", field, field)
+			case PrimitiveInt32, PrimitiveInt64:
+				// The generic decoder always produces a plain int for a
+				// BSON Int32, and either int or int64 for an Int64,
+				// never int32 - never something a direct assertion
+				// against GoType(gen) ("int32"/"int64") can match.
+				emitFallbackDecode(buf, k, field, t, gen)
+			default:
+				// bson.Raw.Unmarshal(&bson.M{}) already decodes these into
+				// the exact Go primitive GoType names, so a direct
+				// assertion is both correct and avoids a reflection round
+				// trip.
+				fmt.Fprintf(buf, "\tif val, ok := m[%q]; ok {\n", k)
+				fmt.Fprintf(buf, "\t\tif typed, ok := val.(%s); ok {\n\t\t\tv.%s = typed\n\t\t}\n\t}\n", t.GoType(gen), field)
+			}
+			continue
+		}
+
+		if _, ok := t.(MixedType); ok {
+			fmt.Fprintf(buf, "\tif val, ok := m[%q]; ok {\n\t\tv.%s = val\n\t}\n", k, field)
+			continue
+		}
+
+		// SliceType, BoundType and NamedType all decode into a Go shape
+		// that a plain assertion against val's dynamic type can't match
+		// ([]interface{} vs. a concrete slice, or an unexported mgo kind
+		// vs. a named/bound type).
+		emitFallbackDecode(buf, k, field, t, gen)
+	}
+	fmt.Fprint(buf, "\treturn nil\n}\n\n")
+}
+
+// emitFallbackDecode writes a SetBSON field assignment that re-marshals
+// m[key] and decodes it straight into a field of fieldType's declared Go
+// type via bson.Unmarshal's own reflection-based decoder, for any field
+// whose declared type a plain assertion against val's dynamic type can't
+// produce.
+func emitFallbackDecode(buf *bytes.Buffer, key, field string, fieldType Type, gen *Generator) {
+	fmt.Fprintf(buf, "\tif val, ok := m[%q]; ok {\n", key)
+	fmt.Fprint(buf, "\t\tvalRaw, err := bson.Marshal(bson.M{\"v\": val})\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(buf, "\t\tvar wrapped struct {\n\t\t\tV %s `bson:\"v\"`\n\t\t}\n", fieldType.GoType(gen))
+	fmt.Fprint(buf, "\t\tif err := bson.Unmarshal(valRaw, &wrapped); err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(buf, "\t\tv.%s = wrapped.V\n\t}\n", field)
+}
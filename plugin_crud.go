@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+// crudPlugin emits a thin set of helpers bound to *mgo.Collection for the
+// generated root struct: FindByID, Insert, Upsert, RemoveByID, and a typed
+// Iter wrapper. These exist so callers don't have to hand-write the same
+// few lines of mgo boilerplate around every generated struct.
+type crudPlugin struct{}
+
+func (crudPlugin) Name() string { return "crud" }
+
+func (crudPlugin) Generate(root StructType, gen *Generator) ([]GeneratedFile, error) {
+	var buf bytes.Buffer
+	name := gen.Struct
+	fmt.Fprintf(&buf, "package %s\n\n", gen.Package)
+	fmt.Fprint(&buf, "import (\n\t\"labix.org/v2/mgo\"\n\t\"labix.org/v2/mgo/bson\"\n)\n\n")
+
+	fmt.Fprintf(&buf, "func Find%sByID(c *mgo.Collection, id bson.ObjectId) (*%s, error) {\n", name, name)
+	fmt.Fprintf(&buf, "\tvar v %s\n\tif err := c.FindId(id).One(&v); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &v, nil\n}\n\n", name)
+
+	fmt.Fprintf(&buf, "func Insert%s(c *mgo.Collection, v *%s) error {\n\treturn c.Insert(v)\n}\n\n", name, name)
+
+	fmt.Fprintf(&buf, "func Upsert%s(c *mgo.Collection, id bson.ObjectId, v *%s) error {\n\t_, err := c.UpsertId(id, v)\n\treturn err\n}\n\n", name, name)
+
+	fmt.Fprintf(&buf, "func Remove%sByID(c *mgo.Collection, id bson.ObjectId) error {\n\treturn c.RemoveId(id)\n}\n\n", name)
+
+	fmt.Fprintf(&buf, "// %sIter wraps *mgo.Iter so callers get %s values back instead of bson.M.\n", name, name)
+	fmt.Fprintf(&buf, "type %sIter struct {\n\t*mgo.Iter\n}\n\n", name)
+	fmt.Fprintf(&buf, "func Find%s(c *mgo.Collection, query interface{}) %sIter {\n\treturn %sIter{c.Find(query).Iter()}\n}\n\n", name, name, name)
+	fmt.Fprintf(&buf, "func (it %sIter) Next(v *%s) bool {\n\treturn it.Iter.Next(v)\n}\n", name, name)
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []GeneratedFile{{Suffix: "_crud.go", Source: formatted}}, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+// structPlugin is the original mongoschema behavior: a single "type Foo
+// struct { ... }" declaration inferred from the scanned documents, plus
+// an import block for whatever TypeBinder bindings fired while inferring
+// it.
+type structPlugin struct{}
+
+func (structPlugin) Name() string { return "struct" }
+
+func (structPlugin) Generate(root StructType, gen *Generator) ([]GeneratedFile, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", gen.Package)
+
+	if imports := collectImports(root); len(imports) > 0 {
+		fmt.Fprint(&buf, "import (\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&buf, "\t%q\n", imp)
+		}
+		fmt.Fprint(&buf, ")\n\n")
+	}
+
+	for _, n := range collectNamedTypes(root) {
+		renderNamedType(&buf, n, gen)
+	}
+
+	fmt.Fprintf(&buf, "type %s %s", gen.Struct, root.GoType(gen))
+
+	if gen.Raw {
+		fmt.Println(buf.String())
+	}
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []GeneratedFile{{Source: formatted}}, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+// validatePlugin emits a Validate method that rejects the zero value of any
+// top-level field observed in every scanned document (gen.FieldPresence[key]
+// == gen.TotalDocs); fields of nested documents are not checked. Those
+// fields are treated as required even though the
+// struct tag still carries omitempty, since mongoschema can only infer
+// presence from sampled data, not a schema's actual constraints.
+type validatePlugin struct{}
+
+func (validatePlugin) Name() string { return "validate" }
+
+func (validatePlugin) Generate(root StructType, gen *Generator) ([]GeneratedFile, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", gen.Package)
+	fmt.Fprint(&buf, "import (\n\t\"fmt\"\n\t\"reflect\"\n)\n\n")
+
+	fmt.Fprintf(&buf, "func (v *%s) Validate() error {\n", gen.Struct)
+	for k := range root {
+		if !isValidFieldName(k) || sscontains(gen.IgnoredKeys, k) {
+			continue
+		}
+		if gen.TotalDocs == 0 || gen.FieldPresence[k] != gen.TotalDocs {
+			continue
+		}
+		field := makeFieldName(k)
+		fmt.Fprintf(&buf, "\tif isZeroValue(v.%s) {\n\t\treturn fmt.Errorf(\"%s: %s is required\")\n\t}\n", field, gen.Struct, k)
+	}
+	fmt.Fprint(&buf, "\treturn nil\n}\n\n")
+
+	// Reflection-based rather than a type switch: it needs to recognize the
+	// zero value of whatever concrete type a field ends up with, including
+	// named enum types promoted by mongoschema itself.
+	fmt.Fprint(&buf, "func isZeroValue(v interface{}) bool {\n")
+	fmt.Fprint(&buf, "\tif v == nil {\n\t\treturn true\n\t}\n")
+	fmt.Fprint(&buf, "\treturn reflect.DeepEqual(v, reflect.Zero(reflect.TypeOf(v)).Interface())\n")
+	fmt.Fprint(&buf, "}\n")
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return []GeneratedFile{{Suffix: "_validate.go", Source: formatted}}, nil
+}
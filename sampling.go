@@ -0,0 +1,319 @@
+package main
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+// Sampling strategies for Generator.SampleStrategy.
+const (
+	SampleHead      = "head"
+	SampleRandom    = "random"
+	SampleReservoir = "reservoir"
+)
+
+// defaultSampleSize is used when -sample-size is left at zero.
+const defaultSampleSize = 1000
+
+// scan walks collection according to s.SampleStrategy and s.Parallel,
+// merging every scanned document into a single StructType and recording
+// field presence as it goes. It replaces the simple "walk from the head"
+// loop mongoschema used to have, which biased schema inference toward a
+// collection's oldest documents on large collections.
+func (s *Generator) scan(collection *mgo.Collection) (StructType, error) {
+	if s.Parallel > 1 {
+		return s.scanParallel(collection)
+	}
+
+	root := StructType{}
+	err := s.runStrategy(collection, bson.M{}, s.Limit, s.SampleSize, func(m bson.M) {
+		s.merge(root, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// runStrategy dispatches to the scan strategy named by s.SampleStrategy,
+// restricted to query (bson.M{} for the whole collection) and bounded by
+// limit/sampleSize, calling keep for every document it selects. It is
+// shared by the unsharded scan above and by each shard in scanParallel, so
+// -parallel narrows the query a strategy runs against instead of replacing
+// the strategy with an unconditional full scan.
+func (s *Generator) runStrategy(collection *mgo.Collection, query bson.M, limit, sampleSize uint, keep func(bson.M)) error {
+	switch s.SampleStrategy {
+	case SampleRandom:
+		supported, err := s.supportsSampleStage(collection)
+		if err != nil {
+			return err
+		}
+		if supported {
+			return scanSampleStage(collection, query, sampleSize, keep)
+		}
+		// $sample needs MongoDB 3.2+; older servers fall back to reservoir
+		// sampling, which gives the same "fair shot for every document"
+		// guarantee without server support.
+		return scanReservoir(collection, query, limit, sampleSize, keep)
+	case SampleReservoir:
+		return scanReservoir(collection, query, limit, sampleSize, keep)
+	default:
+		return scanHead(collection, query, limit, keep)
+	}
+}
+
+// merge folds one scanned document into root and records its field
+// presence, shared by every scan strategy below.
+func (s *Generator) merge(root StructType, m bson.M) {
+	root.Merge(NewType(m, s, ""), s)
+	s.recordPresence(m, "")
+	s.TotalDocs++
+}
+
+func scanHead(collection *mgo.Collection, query bson.M, limit uint, keep func(bson.M)) error {
+	iter := collection.Find(query).Iter()
+	m := bson.M{}
+	var seen uint
+	for iter.Next(m) {
+		if limit != 0 && seen == limit {
+			break
+		}
+		keep(m)
+		m = bson.M{}
+		seen++
+	}
+	return iter.Close()
+}
+
+// scanReservoir implements Algorithm R: the first N documents fill the
+// reservoir outright, then for the k-th document after that (k > N) a slot
+// j := sampleRand.Intn(k) is picked and the document replaces reservoir[j]
+// if j < N. Every document that has been seen ends up equally likely to be
+// in the final sample.
+func scanReservoir(collection *mgo.Collection, query bson.M, limit, sampleSize uint, keep func(bson.M)) error {
+	n := int(sampleSize)
+	if n <= 0 {
+		n = defaultSampleSize
+	}
+
+	reservoir := make([]bson.M, 0, n)
+	iter := collection.Find(query).Iter()
+	m := bson.M{}
+	var k uint
+	for iter.Next(m) {
+		if limit != 0 && k == limit {
+			break
+		}
+		k++
+		if len(reservoir) < n {
+			reservoir = append(reservoir, m)
+		} else if j := sampleRand.Intn(int(k)); j < n {
+			reservoir[j] = m
+		}
+		m = bson.M{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	for _, doc := range reservoir {
+		keep(doc)
+	}
+	return nil
+}
+
+// supportsSampleStage reports whether the connected server is new enough
+// (3.2+) to offer the $sample aggregation stage.
+func (s *Generator) supportsSampleStage(collection *mgo.Collection) (bool, error) {
+	info, err := collection.Database.Session.BuildInfo()
+	if err != nil {
+		return false, err
+	}
+	return info.VersionAtLeast(3, 2), nil
+}
+
+func scanSampleStage(collection *mgo.Collection, query bson.M, sampleSize uint, keep func(bson.M)) error {
+	n := int(sampleSize)
+	if n <= 0 {
+		n = defaultSampleSize
+	}
+
+	pipeline := make([]bson.M, 0, 2)
+	if len(query) > 0 {
+		pipeline = append(pipeline, bson.M{"$match": query})
+	}
+	pipeline = append(pipeline, bson.M{"$sample": bson.M{"size": n}})
+
+	iter := collection.Pipe(pipeline).Iter()
+	m := bson.M{}
+	for iter.Next(m) {
+		keep(m)
+		m = bson.M{}
+	}
+	return iter.Close()
+}
+
+// idShard is a half-open [Min, Max) range of the ObjectId space; an empty
+// Min/Max means unbounded on that side.
+type idShard struct {
+	Min bson.ObjectId
+	Max bson.ObjectId
+}
+
+// objectIDShards splits the ObjectId space spanned by collection's oldest
+// and newest documents into k equal-width buckets by interpolating the
+// embedded creation timestamp, so each shard can be scanned with a plain
+// _id range query. It returns a nil slice, not an error, if collection is
+// empty - there is nothing to shard, and every other scan strategy already
+// degrades to an empty schema in that case rather than failing.
+func objectIDShards(collection *mgo.Collection, k int) ([]idShard, error) {
+	var oldest, newest bson.M
+	if err := collection.Find(nil).Sort("_id").Limit(1).One(&oldest); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := collection.Find(nil).Sort("-_id").Limit(1).One(&newest); err != nil {
+		return nil, err
+	}
+
+	minID, _ := oldest["_id"].(bson.ObjectId)
+	maxID, _ := newest["_id"].(bson.ObjectId)
+	minTime := minID.Time().Unix()
+	span := maxID.Time().Unix() - minTime
+
+	shards := make([]idShard, k)
+	for i := 0; i < k; i++ {
+		var shard idShard
+		if i > 0 {
+			shard.Min = bson.NewObjectIdWithTime(time.Unix(minTime+span*int64(i)/int64(k), 0))
+		}
+		if i < k-1 {
+			shard.Max = bson.NewObjectIdWithTime(time.Unix(minTime+span*int64(i+1)/int64(k), 0))
+		}
+		shards[i] = shard
+	}
+	return shards, nil
+}
+
+// scanParallel opens s.Parallel sessions and scans collection's shards
+// (partitioned by objectIDShards) concurrently, merging each shard's
+// StructType into one result under a mutex. Each shard runs s.SampleStrategy
+// against its own _id range rather than an unconditional full scan, and
+// s.Limit/s.SampleSize are split evenly across shards so the combined
+// result stays close to what a single-threaded scan of the same strategy
+// would have produced.
+func (s *Generator) scanParallel(collection *mgo.Collection) (StructType, error) {
+	k := int(s.Parallel)
+	shards, err := objectIDShards(collection, k)
+	if err != nil {
+		return nil, err
+	}
+	if shards == nil {
+		return StructType{}, nil
+	}
+
+	shardLimit := divideCeil(s.Limit, uint(k))
+
+	// Materialize the effective sample size before dividing: s.SampleSize
+	// left at its zero default would otherwise divide to 0, and each
+	// shard's scanReservoir/scanSampleStage would then independently fall
+	// back to defaultSampleSize on its own, yielding a k-times-larger total
+	// sample instead of the single-threaded scan's size.
+	sampleSize := s.SampleSize
+	if sampleSize == 0 {
+		sampleSize = defaultSampleSize
+	}
+	shardSampleSize := divideCeil(sampleSize, uint(k))
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		root = StructType{}
+		errs = make([]error, k)
+	)
+	baseSession := collection.Database.Session
+	dbName := collection.Database.Name
+	collName := collection.Name
+
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard idShard) {
+			defer wg.Done()
+
+			session := baseSession.Copy()
+			defer session.Close()
+			shardCollection := session.DB(dbName).C(collName)
+
+			query := bson.M{}
+			if shard.Min != "" || shard.Max != "" {
+				idQuery := bson.M{}
+				if shard.Min != "" {
+					idQuery["$gte"] = shard.Min
+				}
+				if shard.Max != "" {
+					idQuery["$lt"] = shard.Max
+				}
+				query["_id"] = idQuery
+			}
+
+			shardRoot := StructType{}
+			err := s.runStrategy(shardCollection, query, shardLimit, shardSampleSize, func(m bson.M) {
+				mu.Lock()
+				s.merge(shardRoot, m)
+				mu.Unlock()
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			mu.Lock()
+			root.Merge(shardRoot, s)
+			mu.Unlock()
+		}(i, shard)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// divideCeil splits total evenly across k shards, rounding up so the sum of
+// shares never falls short of total. A zero total (meaning "unlimited")
+// stays zero.
+func divideCeil(total, k uint) uint {
+	if total == 0 {
+		return 0
+	}
+	return (total + k - 1) / k
+}
+
+// sampleRand is the source behind scanReservoir's random replacement
+// decisions. It is seeded once from a real entropy source rather than left
+// to whatever a given Go toolchain's global math/rand source happens to do
+// by default, so sampling doesn't silently become deterministic (or
+// repeat the same "random" sample run to run) depending on how the binary
+// was built.
+var sampleRand = rand.New(rand.NewSource(seedFromEntropy()))
+
+// seedFromEntropy reads a real random seed from crypto/rand, falling back
+// to the clock only if that read somehow fails.
+func seedFromEntropy() int64 {
+	var buf [8]byte
+	if _, err := cryptorand.Read(buf[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.BigEndian.Uint64(buf[:]))
+}